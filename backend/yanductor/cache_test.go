@@ -0,0 +1,84 @@
+package yanductor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+const testInventoryBody = `{
+	"web": {"hosts": ["web1.example.com"]},
+	"_meta": {"hostvars": {"web1.example.com": {"dc": "dc1"}}}
+}`
+
+func TestLoadRemoteFullFetchThenConditionalNotModified(t *testing.T) {
+	var seenIfNoneMatch string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seenIfNoneMatch = r.Header.Get("If-None-Match")
+		if seenIfNoneMatch == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(testInventoryBody))
+	}))
+	defer srv.Close()
+
+	y := newTestYanductor(t, srv.URL)
+
+	if err := y.loadRemote(false); err != nil {
+		t.Fatalf("initial fetch failed: %s", err)
+	}
+	if len(y.Hosts()) != 1 {
+		t.Fatalf("expected 1 host after the initial 200 response, got %d", len(y.Hosts()))
+	}
+
+	if err := y.loadRemote(false); err != nil {
+		t.Fatalf("conditional fetch failed: %s", err)
+	}
+	if seenIfNoneMatch != `"v1"` {
+		t.Fatalf("expected the second request to send the ETag from the first, got %q", seenIfNoneMatch)
+	}
+	if len(y.Hosts()) != 1 {
+		t.Fatalf("expected the 304 response to leave the inventory intact, got %d hosts", len(y.Hosts()))
+	}
+}
+
+func TestLoadRemoteNotModifiedSkipsReparseWhenAlreadyLoaded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer srv.Close()
+
+	y := newTestYanductor(t, srv.URL)
+	y.parser = countingParser{t: t, inner: ansibleParser{}, parseCount: new(int)}
+	if err := y.parseData([]byte(testInventoryBody)); err != nil {
+		t.Fatalf("seeding the in-memory inventory failed: %s", err)
+	}
+
+	cp := y.parser.(countingParser)
+	before := *cp.parseCount
+
+	if err := y.loadRemote(false); err != nil {
+		t.Fatalf("conditional fetch failed: %s", err)
+	}
+
+	if after := *cp.parseCount; after != before {
+		t.Fatalf("expected no re-parse on a 304 once already loaded, parse count went from %d to %d", before, after)
+	}
+}
+
+// countingParser wraps a Parser and records how many times Parse is called,
+// so a test can assert that a 304 response doesn't trigger a re-parse of the
+// (unchanged) on-disk body once the in-memory inventory is already loaded.
+type countingParser struct {
+	t          *testing.T
+	inner      Parser
+	parseCount *int
+}
+
+func (c countingParser) Parse(data []byte) (*Inventory, error) {
+	*c.parseCount++
+	return c.inner.Parse(data)
+}
@@ -0,0 +1,65 @@
+package yanductor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentHostsAndReload exercises Hosts() from many readers while
+// Reload() repeatedly swaps in a freshly fetched inventory, to be run under
+// `go test -race`: any unsynchronized access to the accessors' backing
+// slices would be flagged by the race detector here. The writer leg is
+// bounded by a fixed number of reloads rather than wall-clock time, and
+// readers yield the scheduler each iteration, so the test can't hang or
+// flake on a CPU-starved runner.
+func TestConcurrentHostsAndReload(t *testing.T) {
+	const reloadCount = 20
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(testInventoryBody))
+	}))
+	defer srv.Close()
+
+	y := newTestYanductor(t, srv.URL)
+	if err := y.loadRemote(false); err != nil {
+		t.Fatalf("initial load failed: %s", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					y.Hosts()
+					y.Groups()
+					y.Datacenters()
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for i := 0; i < reloadCount; i++ {
+			if err := y.Reload(); err != nil {
+				t.Errorf("reload failed: %s", err)
+			}
+		}
+	}()
+
+	wg.Wait()
+}
@@ -0,0 +1,87 @@
+package yanductor
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestYanductor builds a minimal Yanductor sufficient for exercising
+// fetch()/doFetch() against an httptest.Server, without going through New()
+// (which requires a full *config.XCConfig).
+func newTestYanductor(t *testing.T, serverURL string) *Yanductor {
+	t.Helper()
+	return &Yanductor{
+		workgroupNames: []string{"testgroup"},
+		urlTemplate:    serverURL + "/inventory?projects={projects}",
+		httpClient:     &http.Client{Timeout: 200 * time.Millisecond},
+		retries:        2,
+		retryBackoff:   5 * time.Millisecond,
+		parser:         ansibleParser{},
+		cacheDir:       t.TempDir(),
+	}
+}
+
+func TestFetchUnauthorizedDoesNotRetry(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	y := newTestYanductor(t, srv.URL)
+	if _, err := y.fetch(false); err == nil {
+		t.Fatal("expected an error for a 401 response")
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("expected exactly 1 request, got %d", got)
+	}
+}
+
+func TestFetchRetriesOnServerErrorThenSucceeds(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("ETag", `"v2"`)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"_meta":{"hostvars":{}}}`))
+	}))
+	defer srv.Close()
+
+	y := newTestYanductor(t, srv.URL)
+	result, err := y.fetch(false)
+	if err != nil {
+		t.Fatalf("expected fetch to succeed after a retry, got: %s", err)
+	}
+	if result.etag != `"v2"` {
+		t.Fatalf("expected the ETag from the successful response, got %q", result.etag)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected exactly 2 requests (1 failure + 1 retry), got %d", got)
+	}
+}
+
+func TestFetchTimeoutIsRetryable(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	y := newTestYanductor(t, srv.URL)
+	y.retries = 1
+
+	if _, err := y.fetch(false); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Fatalf("expected the timed-out request to be retried once (2 requests), got %d", got)
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package yanductor
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile takes an exclusive advisory flock on f, blocking until it's
+// available, so two xc processes sharing cacheDir can't tear each other's
+// cache writes.
+func lockFile(f *os.File) (unlock func(), err error) {
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+	}, nil
+}
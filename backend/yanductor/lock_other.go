@@ -0,0 +1,12 @@
+//go:build !linux
+
+package yanductor
+
+import "os"
+
+// lockFile is a best-effort no-op on platforms without flock support: cache
+// corruption from concurrent xc processes remains possible there, but the
+// atomic tmp+rename write in saveCache still prevents torn reads.
+func lockFile(f *os.File) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,188 @@
+package yanductor
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/viert/xc/store"
+)
+
+// Inventory is the parsed result of a Parser, adopted into a Yanductor's
+// accessors via parseData's atomic swap.
+type Inventory struct {
+	Hosts       []*store.Host
+	Groups      []*store.Group
+	Datacenters []*store.Datacenter
+	ParentMap   map[string]string
+}
+
+// Parser turns a raw inventory response body into an Inventory. Backends
+// select a Parser via the `format` backend option.
+type Parser interface {
+	Parse(data []byte) (*Inventory, error)
+}
+
+// defaultFormat is used when the `format` backend option isn't set, to
+// preserve the historical rivik.ansible-inventory behaviour.
+const defaultFormat = "ansible"
+
+// parsers holds the built-in Parser implementations, keyed by the `format`
+// backend option.
+var parsers = map[string]Parser{
+	"ansible": ansibleParser{},
+	"flat":    flatParser{},
+}
+
+// ansibleParser understands the Ansible dynamic-inventory shape returned by
+// Conductor's `rivik.ansible-inventory` generator: a map of group name to
+// {children, hosts}, plus a `_meta.hostvars` map keyed by host name.
+type ansibleParser struct{}
+
+func (ansibleParser) Parse(data []byte) (*Inventory, error) {
+	var rawData map[string]interface{}
+	if err := json.Unmarshal(data, &rawData); err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{
+		Hosts:       make([]*store.Host, 0),
+		Groups:      make([]*store.Group, 0),
+		Datacenters: make([]*store.Datacenter, 0),
+		ParentMap:   make(map[string]string),
+	}
+
+	meta, metaOk := rawData["_meta"].(map[string]interface{})
+	if !metaOk {
+		return nil, fmt.Errorf("invalid data format: missing _meta section")
+	}
+
+	hostvars, hostvarsOk := meta["hostvars"].(map[string]interface{})
+	if !hostvarsOk {
+		return nil, fmt.Errorf("invalid data format: missing hostvars section")
+	}
+
+	for group, groupData := range rawData {
+		if group == "_meta" {
+			continue
+		}
+
+		groupMap, groupMapOk := groupData.(map[string]interface{})
+		if !groupMapOk {
+			continue
+		}
+
+		if children, ok := groupMap["children"].([]interface{}); ok {
+			for _, child := range children {
+				childStr, childStrOk := child.(string)
+				if childStrOk {
+					if _, exists := inv.ParentMap[childStr]; !exists {
+						inv.ParentMap[childStr] = group
+					}
+				}
+			}
+		}
+
+		groupObj := &store.Group{
+			Name:     group,
+			ParentID: inv.ParentMap[group],
+		}
+		inv.Groups = append(inv.Groups, groupObj)
+
+		if hostList, ok := groupMap["hosts"].([]interface{}); ok {
+			for _, host := range hostList {
+				hostName, hostNameOk := host.(string)
+				if !hostNameOk {
+					continue
+				}
+
+				hostInfo, hostInfoOk := hostvars[hostName].(map[string]interface{})
+				if !hostInfoOk {
+					continue
+				}
+
+				dc, dcOk := hostInfo["dc"].(string)
+				if !dcOk {
+					dc = ""
+				}
+
+				hostObj := &store.Host{
+					FQDN:         hostName,
+					GroupID:      group,
+					DatacenterID: dc,
+				}
+				inv.Hosts = append(inv.Hosts, hostObj)
+				groupObj.Hosts = append(groupObj.Hosts, hostObj)
+
+				if !containsDatacenter(inv.Datacenters, dc) {
+					inv.Datacenters = append(inv.Datacenters, &store.Datacenter{Name: dc})
+				}
+			}
+		}
+	}
+
+	return inv, nil
+}
+
+// flatInventory is the on-the-wire shape consumed by flatParser: a simple
+// {"hosts": [...], "groups": [...]} document using the Host/Group structs
+// declared in types.go, for Conductor-compatible deployments that don't speak the
+// Ansible dynamic-inventory format.
+type flatInventory struct {
+	Hosts  []Host  `json:"hosts"`
+	Groups []Group `json:"groups"`
+}
+
+// flatParser understands the simple {"hosts":[...],"groups":[...]} schema.
+type flatParser struct{}
+
+func (flatParser) Parse(data []byte) (*Inventory, error) {
+	var raw flatInventory
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	inv := &Inventory{
+		Hosts:       make([]*store.Host, 0, len(raw.Hosts)),
+		Groups:      make([]*store.Group, 0, len(raw.Groups)),
+		Datacenters: make([]*store.Datacenter, 0),
+		ParentMap:   make(map[string]string),
+	}
+
+	groupsByName := make(map[string]*store.Group, len(raw.Groups))
+	for _, g := range raw.Groups {
+		if g.Parent != "" {
+			inv.ParentMap[g.Name] = g.Parent
+		}
+		groupObj := &store.Group{Name: g.Name, ParentID: g.Parent}
+		groupsByName[g.Name] = groupObj
+		inv.Groups = append(inv.Groups, groupObj)
+	}
+
+	for _, h := range raw.Hosts {
+		hostObj := &store.Host{
+			FQDN:         h.Name,
+			GroupID:      h.Group,
+			DatacenterID: h.Datacenter,
+		}
+		inv.Hosts = append(inv.Hosts, hostObj)
+
+		if groupObj, ok := groupsByName[h.Group]; ok {
+			groupObj.Hosts = append(groupObj.Hosts, hostObj)
+		}
+
+		if !containsDatacenter(inv.Datacenters, h.Datacenter) {
+			inv.Datacenters = append(inv.Datacenters, &store.Datacenter{Name: h.Datacenter})
+		}
+	}
+
+	return inv, nil
+}
+
+func containsDatacenter(slice []*store.Datacenter, item string) bool {
+	for _, s := range slice {
+		if s.Name == item {
+			return true
+		}
+	}
+	return false
+}
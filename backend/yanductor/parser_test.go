@@ -0,0 +1,99 @@
+package yanductor
+
+import (
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/viert/xc/store"
+)
+
+func hostFQDNs(hosts []*store.Host) []string {
+	names := make([]string, len(hosts))
+	for i, h := range hosts {
+		names[i] = h.FQDN
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestAnsibleParserGoldenFile(t *testing.T) {
+	data, err := os.ReadFile("testdata/ansible_inventory.json")
+	if err != nil {
+		t.Fatalf("reading golden file: %s", err)
+	}
+
+	inv, err := ansibleParser{}.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse returned an error: %s", err)
+	}
+
+	wantHosts := []string{"db1.example.com", "web1.example.com", "web2.example.com"}
+	if got := hostFQDNs(inv.Hosts); !equalStrings(got, wantHosts) {
+		t.Fatalf("unexpected hosts: got %v, want %v", got, wantHosts)
+	}
+
+	if got, want := inv.ParentMap["web"], "all"; got != want {
+		t.Errorf("unexpected parent for group %q: got %q, want %q", "web", got, want)
+	}
+	if got, want := inv.ParentMap["db"], "all"; got != want {
+		t.Errorf("unexpected parent for group %q: got %q, want %q", "db", got, want)
+	}
+
+	dcByHost := make(map[string]string, len(inv.Hosts))
+	for _, h := range inv.Hosts {
+		dcByHost[h.FQDN] = h.DatacenterID
+	}
+	if got, want := dcByHost["web1.example.com"], "dc1"; got != want {
+		t.Errorf("unexpected dc for web1.example.com: got %q, want %q", got, want)
+	}
+	if got, want := dcByHost["web2.example.com"], "dc2"; got != want {
+		t.Errorf("unexpected dc for web2.example.com: got %q, want %q", got, want)
+	}
+}
+
+func TestFlatParserGoldenFile(t *testing.T) {
+	data, err := os.ReadFile("testdata/flat_inventory.json")
+	if err != nil {
+		t.Fatalf("reading golden file: %s", err)
+	}
+
+	inv, err := flatParser{}.Parse(data)
+	if err != nil {
+		t.Fatalf("Parse returned an error: %s", err)
+	}
+
+	wantHosts := []string{"db1.example.com", "web1.example.com", "web2.example.com"}
+	if got := hostFQDNs(inv.Hosts); !equalStrings(got, wantHosts) {
+		t.Fatalf("unexpected hosts: got %v, want %v", got, wantHosts)
+	}
+
+	if got, want := inv.ParentMap["web"], "all"; got != want {
+		t.Errorf("unexpected parent for group %q: got %q, want %q", "web", got, want)
+	}
+
+	var webGroup *store.Group
+	for _, g := range inv.Groups {
+		if g.Name == "web" {
+			webGroup = g
+		}
+	}
+	if webGroup == nil {
+		t.Fatal("expected a \"web\" group in the parsed inventory")
+	}
+	if len(webGroup.Hosts) != 2 {
+		t.Errorf("expected 2 hosts in the \"web\" group, got %d", len(webGroup.Hosts))
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,6 +1,10 @@
 package yanductor
 
 import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/viert/xc/store"
@@ -12,11 +16,25 @@ type Yanductor struct {
     cacheTTL       time.Duration
     cacheDir       string
     apiURL         string
-    hosts          []*store.Host
-    groups         []*store.Group
-    workgroups     []*store.WorkGroup
-    datacenters    []*store.Datacenter
-    parentMap      map[string]string
+    urlTemplate    string
+    parser         Parser
+    httpClient     *http.Client
+    retries        int
+    retryBackoff   time.Duration
+    authToken      string
+    authTokenFile  string
+    authTokenEnv   string
+    forceReload    bool
+    cancel         context.CancelFunc
+    done           chan struct{}
+
+    mu          sync.RWMutex
+    loaded      bool
+    hosts       []*store.Host
+    groups      []*store.Group
+    workgroups  []*store.WorkGroup
+    datacenters []*store.Datacenter
+    parentMap   map[string]string
 }
 
 // Host represents a host in the inventory
@@ -31,3 +49,23 @@ type Group struct {
     Name   string `json:"name"`
     Parent string `json:"parent"`
 }
+
+// cacheMeta holds the HTTP validators for a cached inventory response, so
+// the next fetch can use a conditional GET instead of re-downloading
+// unchanged data.
+type cacheMeta struct {
+    ETag         string
+    LastModified string
+}
+
+// cacheEnvelope is the versioned on-disk wrapper around a cached inventory
+// response. cacheSchemaVersion lets readCacheEnvelope discard caches
+// written by an incompatible earlier version instead of failing to parse
+// them once parseData's expectations change.
+type cacheEnvelope struct {
+    Schema       int             `json:"schema"`
+    FetchedAt    time.Time       `json:"fetched_at"`
+    ETag         string          `json:"etag,omitempty"`
+    LastModified string          `json:"last_modified,omitempty"`
+    Body         json.RawMessage `json:"body"`
+}
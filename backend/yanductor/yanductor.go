@@ -1,20 +1,45 @@
 package yanductor
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"path"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/viert/xc/config"
+	"github.com/viert/xc/log"
 	"github.com/viert/xc/store"
 )
 
+const (
+	defaultTimeout        = 10 * time.Second
+	defaultConnectTimeout = 5 * time.Second
+	defaultRetries        = 3
+	defaultRetryBackoff   = 200 * time.Millisecond
+)
+
+// cacheSchemaVersion is bumped whenever the on-disk cacheEnvelope layout
+// changes incompatibly; readCacheEnvelope discards caches written by a
+// different version instead of failing to parse them.
+const cacheSchemaVersion = 1
+
+// errIncompatibleCacheSchema is returned by readCacheEnvelope when the
+// on-disk cache was written by a different cacheSchemaVersion. Callers treat
+// it like a cache miss rather than a hard failure.
+var errIncompatibleCacheSchema = errors.New("yanductor: cache schema is incompatible")
+
 // New creates a new instance of Yanductor backend
 func New(cfg *config.XCConfig) (*Yanductor, error) {
 	y := &Yanductor{
@@ -45,8 +70,71 @@ func New(cfg *config.XCConfig) (*Yanductor, error) {
 
 	y.apiURL = apiURL
 
+	// url_template configuration: the URL fetched on Reload, with {projects}
+	// replaced by the comma-joined workgroup names. Defaults to the
+	// historical rivik.ansible-inventory generator endpoint.
+	urlTemplate, found := options["url_template"]
+	if !found {
+		urlTemplate = apiURL + "/api/generator/rivik.ansible-inventory?projects={projects}"
+	}
+	y.urlTemplate = urlTemplate
+
+	// format configuration: selects the Parser used to turn the fetched (or
+	// cached) body into an Inventory.
+	format := options["format"]
+	if format == "" {
+		format = defaultFormat
+	}
+	parser, found := parsers[format]
+	if !found {
+		return nil, fmt.Errorf("yanductor backend: unknown format %q", format)
+	}
+	y.parser = parser
+
+	// auth configuration
+	y.authToken = options["token"]
+	y.authTokenFile = options["token_file"]
+	y.authTokenEnv = options["token_env"]
+
+	// retry configuration
+	y.retries = defaultRetries
+	if rs, found := options["retries"]; found {
+		r, err := strconv.Atoi(rs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid yanductor retries value %q: %s", rs, err)
+		}
+		if r < 0 {
+			return nil, fmt.Errorf("invalid yanductor retries value %q: must not be negative", rs)
+		}
+		y.retries = r
+	}
+
+	y.retryBackoff = defaultRetryBackoff
+	if rb, found := options["retry_backoff"]; found {
+		d, err := time.ParseDuration(rb)
+		if err != nil {
+			return nil, fmt.Errorf("invalid yanductor retry_backoff value %q: %s", rb, err)
+		}
+		y.retryBackoff = d
+	}
+
+	client, err := buildHTTPClient(options)
+	if err != nil {
+		return nil, fmt.Errorf("error configuring yanductor http client: %s", err)
+	}
+	y.httpClient = client
+
+	// force_reload configuration
+	if frs, found := options["force_reload"]; found {
+		fr, err := strconv.ParseBool(frs)
+		if err != nil {
+			return nil, fmt.Errorf("invalid yanductor force_reload value %q: %s", frs, err)
+		}
+		y.forceReload = fr
+	}
+
 	// Load data to populate fields
-	err := y.Load()
+	err = y.Load()
 	if err != nil {
 		return nil, fmt.Errorf("error loading data: %s", err)
 	}
@@ -54,38 +142,207 @@ func New(cfg *config.XCConfig) (*Yanductor, error) {
 	return y, nil
 }
 
+// buildHTTPClient constructs the *http.Client used to talk to the Conductor
+// API, applying request/connect timeouts and optional mTLS from options.
+func buildHTTPClient(options map[string]string) (*http.Client, error) {
+	timeout := defaultTimeout
+	if ts, found := options["timeout"]; found {
+		d, err := time.ParseDuration(ts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout value %q: %s", ts, err)
+		}
+		timeout = d
+	}
+
+	connectTimeout := defaultConnectTimeout
+	if cts, found := options["connect_timeout"]; found {
+		d, err := time.ParseDuration(cts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid connect_timeout value %q: %s", cts, err)
+		}
+		connectTimeout = d
+	}
+
+	dialer := &net.Dialer{Timeout: connectTimeout}
+	transport := &http.Transport{
+		DialContext: dialer.DialContext,
+	}
+
+	certFile, hasCert := options["cert_file"]
+	keyFile, hasKey := options["key_file"]
+	if hasCert != hasKey {
+		return nil, fmt.Errorf("cert_file and key_file must be configured together")
+	}
+
+	tlsConfig := &tls.Config{}
+	configureTLS := false
+
+	if hasCert && hasKey {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %s", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+		configureTLS = true
+	}
+
+	if caFile, found := options["ca_file"]; found {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ca_file: %s", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca_file %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+		configureTLS = true
+	}
+
+	if configureTLS {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return &http.Client{Timeout: timeout, Transport: transport}, nil
+}
+
+// authHeader resolves the Authorization header value to use for requests,
+// preferring a token file (re-read on every call so rotated tokens are
+// picked up) over a static token option or an environment variable.
+func (y *Yanductor) authHeader() (string, error) {
+	token := y.authToken
+
+	if y.authTokenFile != "" {
+		data, err := os.ReadFile(y.authTokenFile)
+		if err != nil {
+			return "", fmt.Errorf("error reading token_file: %s", err)
+		}
+		token = strings.TrimSpace(string(data))
+	} else if token == "" && y.authTokenEnv != "" {
+		token = os.Getenv(y.authTokenEnv)
+	}
+
+	if token == "" {
+		return "", nil
+	}
+
+	return "OAuth " + token, nil
+}
+
+// isRetryableStatus reports whether an HTTP status code warrants a retry.
+func isRetryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
 // Hosts returns the list of hosts
 func (y *Yanductor) Hosts() []*store.Host {
-	return y.hosts
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	hosts := make([]*store.Host, len(y.hosts))
+	copy(hosts, y.hosts)
+	return hosts
 }
 
 // Groups returns the list of groups
 func (y *Yanductor) Groups() []*store.Group {
-	return y.groups
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	groups := make([]*store.Group, len(y.groups))
+	copy(groups, y.groups)
+	return groups
 }
 
 // WorkGroups returns the list of workgroups
 func (y *Yanductor) WorkGroups() []*store.WorkGroup {
-	return y.workgroups
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	workgroups := make([]*store.WorkGroup, len(y.workgroups))
+	copy(workgroups, y.workgroups)
+	return workgroups
 }
 
 // Datacenters returns the list of datacenters
 func (y *Yanductor) Datacenters() []*store.Datacenter {
-	return y.datacenters
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	datacenters := make([]*store.Datacenter, len(y.datacenters))
+	copy(datacenters, y.datacenters)
+	return datacenters
+}
+
+// Start launches a background goroutine that refreshes the inventory every
+// cacheTTL, with ±10% jitter to avoid a thundering herd against the
+// Conductor API when many xc instances start together. The goroutine stops
+// when ctx is cancelled or Stop is called.
+func (y *Yanductor) Start(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	y.cancel = cancel
+	y.done = make(chan struct{})
+	go y.refreshLoop(ctx)
 }
 
-// Load tries to load data from cache unless it's expired
-// In case of cache expiration or absence it triggers Reload()
+// Stop cancels the background refresher started by Start and waits for it
+// to exit.
+func (y *Yanductor) Stop() {
+	if y.cancel == nil {
+		return
+	}
+	y.cancel()
+	<-y.done
+}
+
+func (y *Yanductor) refreshLoop(ctx context.Context) {
+	defer close(y.done)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(y.jitteredTTL()):
+			if err := y.Reload(); err != nil {
+				log.Debugf("yanductor: background refresh failed: %s", err)
+			}
+		}
+	}
+}
+
+// jitteredTTL returns cacheTTL adjusted by a random factor within ±10%,
+// so that many xc instances started at once don't all hit the Conductor
+// API at exactly the same moment.
+func (y *Yanductor) jitteredTTL() time.Duration {
+	jitter := 0.1 * float64(y.cacheTTL)
+	offset := (rand.Float64()*2 - 1) * jitter
+	return y.cacheTTL + time.Duration(offset)
+}
+
+// Load tries to load data from cache unless it's expired. In case of cache
+// expiration, absence, or an incompatible schema (e.g. the first run after a
+// cacheSchemaVersion bump) it triggers Reload() instead of failing.
 func (y *Yanductor) Load() error {
 	if y.cacheExpired() {
 		return y.Reload()
 	}
-	return y.loadLocal()
+	err := y.loadLocal()
+	if errors.Is(err, errIncompatibleCacheSchema) {
+		return y.Reload()
+	}
+	return err
 }
 
-// Reload forces reloading data from HTTP(S)
+// Reload forces reloading data from HTTP(S), using conditional GET
+// validators to skip the download when the inventory hasn't changed
+// unless the backend is configured with force_reload.
 func (y *Yanductor) Reload() error {
-	err := y.loadRemote()
+	err := y.loadRemote(y.forceReload)
+	if err != nil {
+		return y.loadLocal()
+	}
+	return nil
+}
+
+// ForceReload reloads data from HTTP(S), bypassing ETag/Last-Modified
+// validators even if the remote inventory appears unchanged.
+func (y *Yanductor) ForceReload() error {
+	err := y.loadRemote(true)
 	if err != nil {
 		return y.loadLocal()
 	}
@@ -93,11 +350,11 @@ func (y *Yanductor) Reload() error {
 }
 
 func (y *Yanductor) loadLocal() error {
-	data, err := os.ReadFile(y.cacheFilename())
+	env, err := y.readCacheEnvelope()
 	if err != nil {
 		return err
 	}
-	return y.parseData(data)
+	return y.parseData(env.Body)
 }
 
 func (y *Yanductor) cacheExpired() bool {
@@ -112,129 +369,246 @@ func (y *Yanductor) cacheFilename() string {
     return path.Join(y.cacheDir, fmt.Sprintf("yanductor_cache_%s.json", strings.Join(y.workgroupNames, "_")))
 }
 
+func (y *Yanductor) lockFilename() string {
+	return y.cacheFilename() + ".lock"
+}
 
-func (y *Yanductor) saveCache(data []byte) error {
-	err := os.MkdirAll(y.cacheDir, 0755)
-	if err != nil {
+// withCacheLock serializes fn against other xc processes sharing cacheDir,
+// via an advisory flock on a dedicated lock file next to the cache.
+func (y *Yanductor) withCacheLock(fn func() error) error {
+	if err := os.MkdirAll(y.cacheDir, 0755); err != nil {
 		return fmt.Errorf("error creating cache dir: %s", err)
 	}
-	return os.WriteFile(y.cacheFilename(), data, 0644)
-}
 
-func (y *Yanductor) loadRemote() error {
-	url := fmt.Sprintf("%s/api/generator/rivik.ansible-inventory?projects=%s", y.apiURL, strings.Join(y.workgroupNames, ","))
-	resp, err := http.Get(url)
+	lf, err := os.OpenFile(y.lockFilename(), os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return err
 	}
-	defer resp.Body.Close()
+	defer lf.Close()
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("status code %d while fetching %s", resp.StatusCode, url)
+	unlock, err := lockFile(lf)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	data, err := io.ReadAll(resp.Body)
+	return fn()
+}
+
+// saveCache atomically persists the fetched inventory body, wrapped in a
+// versioned envelope together with its HTTP validators, so a crash or a
+// concurrently running xc process can never observe a torn write.
+func (y *Yanductor) saveCache(data []byte, etag, lastModified string) error {
+	return y.withCacheLock(func() error {
+		env := cacheEnvelope{
+			Schema:       cacheSchemaVersion,
+			FetchedAt:    time.Now(),
+			ETag:         etag,
+			LastModified: lastModified,
+			Body:         json.RawMessage(data),
+		}
+		payload, err := json.Marshal(env)
+		if err != nil {
+			return err
+		}
+
+		tmpFilename := y.cacheFilename() + ".tmp"
+		if err := os.WriteFile(tmpFilename, payload, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmpFilename, y.cacheFilename())
+	})
+}
+
+// readCacheEnvelope reads and validates the on-disk cache envelope,
+// discarding (returning an error for) caches written by an incompatible
+// schema version.
+func (y *Yanductor) readCacheEnvelope() (*cacheEnvelope, error) {
+	var env cacheEnvelope
+	err := y.withCacheLock(func() error {
+		data, err := os.ReadFile(y.cacheFilename())
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &env); err != nil {
+			return err
+		}
+		if env.Schema != cacheSchemaVersion {
+			return fmt.Errorf("%w: schema %d, current %d", errIncompatibleCacheSchema, env.Schema, cacheSchemaVersion)
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return &env, nil
+}
+
+// touchCache resets the cache file's mtime so a 304 response extends the
+// TTL without requiring a fresh download.
+func (y *Yanductor) touchCache() error {
+	return y.withCacheLock(func() error {
+		now := time.Now()
+		return os.Chtimes(y.cacheFilename(), now, now)
+	})
+}
+
+// fetchResult carries the outcome of a (possibly conditional) inventory
+// fetch: either a fresh body plus the validators to persist for next time,
+// or an indication that the server said the cached copy is still current.
+type fetchResult struct {
+	notModified  bool
+	data         []byte
+	etag         string
+	lastModified string
+}
 
-	err = y.parseData(data)
+func (y *Yanductor) loadRemote(force bool) error {
+	result, err := y.fetch(force)
 	if err != nil {
+		log.Debugf("yanductor: error fetching inventory: %s", err)
 		return err
 	}
 
-	return y.saveCache(data)
+	if result.notModified {
+		if err := y.touchCache(); err != nil {
+			log.Debugf("yanductor: error touching cache file: %s", err)
+		}
+		// The in-memory inventory is already current for anything but a cold
+		// start from disk, so there's no need to re-parse the unchanged body.
+		if y.isLoaded() {
+			return nil
+		}
+		return y.loadLocal()
+	}
+
+	if err := y.parseData(result.data); err != nil {
+		return err
+	}
+
+	return y.saveCache(result.data, result.etag, result.lastModified)
 }
 
-func (y *Yanductor) parseData(data []byte) error {
-    var rawData map[string]interface{}
-    err := json.Unmarshal(data, &rawData)
-    if err != nil {
-        return err
-    }
+// fetch performs the authenticated HTTP request for the inventory, sending
+// conditional GET validators unless force is set, and retrying retryable
+// errors (5xx, 429, network errors) with exponential backoff and jitter
+// before giving up.
+func (y *Yanductor) fetch(force bool) (*fetchResult, error) {
+	url := strings.Replace(y.urlTemplate, "{projects}", strings.Join(y.workgroupNames, ","), 1)
 
-    y.hosts = make([]*store.Host, 0)
-    y.groups = make([]*store.Group, 0)
-    y.datacenters = make([]*store.Datacenter, 0)
-    y.parentMap = make(map[string]string)
+	auth, err := y.authHeader()
+	if err != nil {
+		return nil, err
+	}
 
-    meta, metaOk := rawData["_meta"].(map[string]interface{})
-    if !metaOk {
-        return fmt.Errorf("invalid data format: missing _meta section")
-    }
+	meta := &cacheMeta{}
+	if !force {
+		// A missing or schema-incompatible cache just means no validators to
+		// send; fall through to an unconditional fetch.
+		if env, envErr := y.readCacheEnvelope(); envErr == nil {
+			meta.ETag = env.ETag
+			meta.LastModified = env.LastModified
+		}
+	}
 
-    hostvars, hostvarsOk := meta["hostvars"].(map[string]interface{})
-    if !hostvarsOk {
-        return fmt.Errorf("invalid data format: missing hostvars section")
-    }
+	var lastErr error
+	for attempt := 0; attempt <= y.retries; attempt++ {
+		if attempt > 0 {
+			delay := y.retryBackoff * time.Duration(1<<uint(attempt-1))
+			delay += time.Duration(rand.Int63n(int64(y.retryBackoff) + 1))
+			log.Debugf("yanductor: retrying fetch of %s in %s (attempt %d/%d)", url, delay, attempt, y.retries)
+			time.Sleep(delay)
+		}
 
-    for group, groupData := range rawData {
-        if group == "_meta" {
-            continue
-        }
-
-        groupMap, groupMapOk := groupData.(map[string]interface{})
-        if !groupMapOk {
-            continue
-        }
-
-        if children, ok := groupMap["children"].([]interface{}); ok {
-            for _, child := range children {
-                childStr, childStrOk := child.(string)
-                if childStrOk {
-                    if _, exists := y.parentMap[childStr]; !exists {
-                        y.parentMap[childStr] = group
-                    }
-                }
-            }
-        }
-
-        groupObj := &store.Group{
-            Name:     group,
-            ParentID: y.parentMap[group],
-        }
-        y.groups = append(y.groups, groupObj)
-
-        if hosts, ok := groupMap["hosts"].([]interface{}); ok {
-            for _, host := range hosts {
-                hostName, hostNameOk := host.(string)
-                if !hostNameOk {
-                    continue
-                }
-
-                hostInfo, hostInfoOk := hostvars[hostName].(map[string]interface{})
-                if !hostInfoOk {
-                    continue
-                }
-
-                dc, dcOk := hostInfo["dc"].(string)
-                if !dcOk {
-                    dc = ""
-                }
-
-                hostObj := &store.Host{
-                    FQDN:         hostName,
-                    GroupID:      group,
-                    DatacenterID: dc,
-                }
-                y.hosts = append(y.hosts, hostObj)
-                groupObj.Hosts = append(groupObj.Hosts, hostObj)
-
-                if !contains(y.datacenters, dc) {
-                    y.datacenters = append(y.datacenters, &store.Datacenter{Name: dc})
-                }
-            }
-        }
-    }
+		result, retryable, err := y.doFetch(url, auth, meta)
+		if err == nil {
+			return result, nil
+		}
+
+		lastErr = err
+		if !retryable {
+			return nil, err
+		}
+		log.Debugf("yanductor: fetch attempt %d/%d failed: %s", attempt+1, y.retries+1, err)
+	}
 
-    return nil
+	return nil, lastErr
 }
 
-func contains(slice []*store.Datacenter, item string) bool {
-	for _, s := range slice {
-		if s.Name == item {
-			return true
-		}
+// doFetch issues a single request, returning whether the failure (if any)
+// is retryable.
+func (y *Yanductor) doFetch(url, auth string, meta *cacheMeta) (result *fetchResult, retryable bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+
+	resp, err := y.httpClient.Do(req)
+	if err != nil {
+		// network errors (including client timeouts) are retryable
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return &fetchResult{notModified: true}, false, nil
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, false, fmt.Errorf("status code %d while fetching %s", resp.StatusCode, url)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, isRetryableStatus(resp.StatusCode), fmt.Errorf("status code %d while fetching %s", resp.StatusCode, url)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
 	}
-	return false
+
+	return &fetchResult{
+		data:         data,
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}, false, nil
+}
+
+// parseData parses a freshly fetched or locally cached inventory body using
+// the configured Parser and atomically swaps it in, so that concurrent
+// readers via Hosts(), Groups() etc. never observe a partially rebuilt
+// inventory.
+func (y *Yanductor) parseData(data []byte) error {
+	inv, err := y.parser.Parse(data)
+	if err != nil {
+		return err
+	}
+
+	y.mu.Lock()
+	y.hosts = inv.Hosts
+	y.groups = inv.Groups
+	y.datacenters = inv.Datacenters
+	y.parentMap = inv.ParentMap
+	y.loaded = true
+	y.mu.Unlock()
+
+	return nil
+}
+
+// isLoaded reports whether the in-memory inventory has already been
+// populated by a previous parseData call, so a 304 response can skip
+// re-parsing the unchanged local cache.
+func (y *Yanductor) isLoaded() bool {
+	y.mu.RLock()
+	defer y.mu.RUnlock()
+	return y.loaded
 }